@@ -0,0 +1,69 @@
+package boxer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestValidCryptAEAD(t *testing.T) {
+	aeadKey := [32]byte{1, 2, 3}
+	aead, err := chacha20poly1305.New(aeadKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := make([]byte, aead.NonceSize())
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorAEAD(&buf, aead, n, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	d, err := NewDecryptorAEAD(&buf, aead, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, d); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Fatalf("data len == %d, out len == %d", len(data), out.Len())
+	}
+}
+
+func TestWrongKeyAEAD(t *testing.T) {
+	aeadKey := [32]byte{1, 2, 3}
+	aead, err := chacha20poly1305.New(aeadKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := make([]byte, aead.NonceSize())
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorAEAD(&buf, aead, n, DefaultChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	wrongKey := [32]byte{9, 9, 9}
+	wrongAEAD, err := chacha20poly1305.New(wrongKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecryptorAEAD(&buf, wrongAEAD, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, d); err != ErrInvalidData {
+		t.Fatalf("wanted ErrInvalidData, got %v", err)
+	}
+}
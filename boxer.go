@@ -1,14 +1,19 @@
 // Package boxer is a streaming encryption implementation, based on Adam
 // Langley's article: https://www.imperialviolet.org/2014/06/27/streamingencryption.html
 //
-// In short, nacl/secretbox is used to seal a file in chunks, with each chunk
-// being prefixed with its length. The nonce is incrementally marked so
+// In short, a crypto/cipher.AEAD is used to seal a file in chunks, with each
+// chunk being prefixed with its length. The nonce is incrementally marked so
 // chunks are guaranteed to be in order. The encrypted blob is prepended with
-// a header containing a version ID, the maximum chunk size, and flags. The
-// flags are currently unused, but may be used in future versions.
+// a header containing a version ID, a cipher ID, and the maximum chunk size.
+//
+// By default nacl/secretbox is used, but NewEncryptorAEAD and
+// NewDecryptorAEAD accept any cipher.AEAD implementation (e.g.
+// chacha20poly1305 or AES-256-GCM) for users that need a FIPS-allowed or
+// hardware-accelerated primitive.
 package boxer
 
 import (
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -21,6 +26,8 @@ var (
 	ErrAlreadyClosed = errors.New("encryptor: already closed")
 	ErrInvalidData   = errors.New("decryptor: encrypted message is invalid")
 	ErrChunkSize     = errors.New("boxer: invalid chunk size")
+	ErrCipherID      = errors.New("boxer: cipher does not match stream")
+	ErrNonceSize     = errors.New("boxer: invalid nonce size")
 )
 
 const (
@@ -28,7 +35,8 @@ const (
 	// writing.
 	DefaultChunkSize = 65536
 
-	// Overhead is the number of bytes of overhead when boxing a message.
+	// Overhead is the number of bytes of overhead when boxing a message
+	// with the default secretbox-based cipher.
 	Overhead = secretbox.Overhead
 
 	// offset is the number of bytes used to advise the length of the
@@ -39,12 +47,65 @@ const (
 	ver1 = 1
 )
 
-func nonceKey(nonce *[16]byte, key *[32]byte) (*[24]byte, *[32]byte) {
+// Cipher IDs, written as the second byte of the header so a Decryptor can
+// verify it was constructed the same way as the Encryptor that sealed the
+// stream (secretbox, caller-supplied AEAD, ratchet, or AEAD with context).
+// Every caller-supplied AEAD shares one ID, so the header does not identify
+// which AEAD algorithm was used: a Decryptor given a different AEAD passes
+// this check and fails with ErrInvalidData when it opens a chunk.
+const (
+	cipherSecretbox byte = iota
+	cipherAEAD
+	cipherSecretboxRatchet
+	cipherAEADContext
+)
+
+// secretboxAEAD adapts nacl/secretbox to the cipher.AEAD interface so the
+// chunk-framing code in Encryptor/Decryptor only ever has to deal with one
+// type. It is the default cipher used by NewEncryptor and NewEncryptorSize,
+// keeping version 1 wire compatibility, and also backs the password and
+// ratchet constructors; secretbox has no notion of associated data, so
+// AEAD.Seal/Open ignore it.
+type secretboxAEAD struct {
+	key *[32]byte
+}
+
+func (secretboxAEAD) NonceSize() int { return 24 }
+func (secretboxAEAD) Overhead() int  { return secretbox.Overhead }
+
+func (s secretboxAEAD) zero() {
+	for i := range s.key {
+		s.key[i] = 0
+	}
+}
+
+// Seal and Open copy their input before calling into nacl/secretbox, which
+// (unlike cipher.AEAD) panics on any overlap between dst and its input;
+// cipher.AEAD callers are entitled to pass dst == input[:0].
+
+func (s secretboxAEAD) Seal(dst, nonce, plaintext, _ []byte) []byte {
 	var n [24]byte
-	copy(n[:], nonce[:])
-	var k [32]byte
-	copy(k[:], key[:])
-	return &n, &k
+	copy(n[:], nonce)
+	msg := append([]byte(nil), plaintext...)
+	return secretbox.Seal(dst, msg, &n, s.key)
+}
+
+func (s secretboxAEAD) Open(dst, nonce, ciphertext, _ []byte) ([]byte, error) {
+	var n [24]byte
+	copy(n[:], nonce)
+	box := append([]byte(nil), ciphertext...)
+	out, ok := secretbox.Open(dst, box, &n, s.key)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+	return out, nil
+}
+
+// keyZeroer is implemented by AEADs that hold wipeable key material.
+// Encryptor.Close and Decryptor.Close call it, when present, so the key
+// doesn't linger in memory after the stream is done with it.
+type keyZeroer interface {
+	zero()
 }
 
 type chunk uint32
@@ -52,17 +113,20 @@ type chunk uint32
 // Encryptor is an io.WriteCloser. Writes to an Encryptor are encrypted
 // and written to w.
 type Encryptor struct {
-	w     io.Writer // underlying writer
-	nonce *[24]byte // nacl nonce, increments per chunk
-	key   *[32]byte // encryption key
-	in    []byte    // input buffer
-	out   []byte    // encryption buffer
-	size  int       // chunk size
-	n     int       // end of buffer
-	err   error     // last error
+	w               io.Writer     // underlying writer
+	aead            cipher.AEAD   // sealing primitive
+	cipherID        byte          // written to the header, checked on decrypt
+	nonce           []byte        // nonce, incremented per chunk
+	in              []byte        // input buffer, accumulates a partial chunk across Writes
+	size            int           // chunk size
+	n               int           // end of buffer
+	err             error         // last error
+	ratchet         *ratchetState // non-nil when re-keying every ratchetInterval chunks
+	ratchetInterval uint32        // written to the header when ratchet != nil
+	context         []byte        // bound to every chunk as AEAD associated data
 }
 
-// NewEncryptor returns a new Encryptor. Writes to the returned Encryptor
+// NewEncryptorSize returns a new Encryptor. Writes to the returned Encryptor
 // are encrypted and written to w. The size parameter dictates the maximum
 // chunk size. It should be a positive integer in the range [0, 1 << 32 - 1].
 // Writes will always be chunk size + Overhead.
@@ -72,33 +136,78 @@ type Encryptor struct {
 //
 // Neither nonce or key are modified.
 func NewEncryptorSize(w io.Writer, nonce *[16]byte, key *[32]byte, size int) (*Encryptor, error) {
+	var n [24]byte
+	copy(n[:], nonce[:])
+	var k [32]byte
+	copy(k[:], key[:])
+	return newEncryptor(w, secretboxAEAD{&k}, cipherSecretbox, n[:], size, 0, nil)
+}
+
+// NewEncryptor creates an Encryptor with the default chunk size.
+func NewEncryptor(w io.Writer, nonce *[16]byte, key *[32]byte) *Encryptor {
+	enc, _ := NewEncryptorSize(w, nonce, key, DefaultChunkSize)
+	return enc
+}
+
+// NewEncryptorAEAD returns a new Encryptor that seals chunks with aead
+// instead of the default nacl/secretbox. nonce must be aead.NonceSize()
+// bytes long. The chunk overhead is derived from aead.Overhead(), so any
+// AEAD implementation (ChaCha20-Poly1305, AES-256-GCM,
+// XChaCha20-Poly1305, ...) may be used.
+//
+// Neither nonce nor aead is modified; the Encryptor increments its own copy
+// of nonce as chunks are written.
+func NewEncryptorAEAD(w io.Writer, aead cipher.AEAD, nonce []byte, size int) (*Encryptor, error) {
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrNonceSize
+	}
+	n := make([]byte, len(nonce))
+	copy(n, nonce)
+	return newEncryptor(w, aead, cipherAEAD, n, size, 0, nil)
+}
+
+// newEncryptor builds an Encryptor around aead/nonce and writes the header.
+// ratchetInterval is 0 unless cipherID is cipherSecretboxRatchet, and
+// context is nil unless cipherID is cipherAEADContext; whichever applies is
+// also written to the header.
+func newEncryptor(w io.Writer, aead cipher.AEAD, cipherID byte, nonce []byte, size int, ratchetInterval uint32, context []byte) (*Encryptor, error) {
 	if size > math.MaxInt32 {
 		return nil, ErrChunkSize
 	}
-	e := Encryptor{w: w, size: size}
-	err := e.writeHeaders()
-	if err != nil {
+	e := Encryptor{w: w, aead: aead, cipherID: cipherID, size: size, ratchetInterval: ratchetInterval, context: context}
+	if err := e.writeHeaders(nonce); err != nil {
 		return nil, err
 	}
 	// Save the allocations until after we've determined everything is kosher.
 	e.in = make([]byte, e.size)
-	e.out = make([]byte, offset+Overhead+e.size)
-	e.nonce, e.key = nonceKey(nonce, key)
+	e.nonce = nonce
 	return &e, nil
 }
 
-// NewEncryptor creates an Encryptor with the default chunk size.
-func NewEncryptor(w io.Writer, nonce *[16]byte, key *[32]byte) *Encryptor {
-	enc, _ := NewEncryptorSize(w, nonce, key, DefaultChunkSize)
-	return enc
-}
-
-func (e *Encryptor) writeHeaders() error {
-	_, err := e.w.Write([]byte{ver1 /* version */, 0 /* flags */})
+// writeHeaders writes the fixed ver+cipherID+size header, followed by
+// whichever trailing field cipherID calls for. nonce is the stream's chunk
+// nonce; for cipherAEADContext it also seeds the tag that binds the context
+// to the header (see headerNonce). That trailing field is aead.Overhead()
+// bytes of AEAD output, not a plain hash or HMAC: it's what aead.Seal
+// returns for an empty plaintext with context as associated data, so it can
+// only be produced or verified by someone holding aead's key.
+func (e *Encryptor) writeHeaders(nonce []byte) error {
+	_, err := e.w.Write([]byte{ver1 /* version */, e.cipherID})
 	if err != nil {
 		return err
 	}
-	return binary.Write(e.w, binary.LittleEndian, uint32(e.size))
+	if err := binary.Write(e.w, binary.LittleEndian, uint32(e.size)); err != nil {
+		return err
+	}
+	switch e.cipherID {
+	case cipherSecretboxRatchet:
+		return binary.Write(e.w, binary.LittleEndian, e.ratchetInterval)
+	case cipherAEADContext:
+		tag := e.aead.Seal(nil, headerNonce(nonce), nil, e.context)
+		_, err := e.w.Write(tag)
+		return err
+	}
+	return nil
 }
 
 // Writer writes an encrypted form of p to the underlying io.Writer. The
@@ -126,11 +235,17 @@ func (e *Encryptor) flush() error {
 	if e.err != nil {
 		return e.err
 	}
-	enc := secretbox.Seal(e.out[offset:offset], e.in[:e.n], e.nonce, e.key)
-	binary.LittleEndian.PutUint32(e.out[0:], uint32(len(enc)))
-	_, e.err = e.w.Write(e.out[:offset+len(enc)])
+	buf := getBuf(offset + e.aead.Overhead() + e.size)
+	defer putBuf(buf)
+
+	enc := e.aead.Seal(buf[offset:offset], e.nonce, e.in[:e.n], e.context)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(enc)))
+	_, e.err = e.w.Write(buf[:offset+len(enc)])
 	e.n = 0
 	incrCounter(e.nonce)
+	if e.ratchet != nil {
+		e.ratchet.step()
+	}
 	return e.err
 }
 
@@ -142,28 +257,28 @@ func (e *Encryptor) Close() (err error) {
 	}
 	// Write out any pending data, mark the nonce, then write our EOF byte.
 	e.flush()
-	e.nonce[23] |= 0x80
+	e.nonce[len(e.nonce)-1] |= 0x80
 	_, err = e.Write([]byte{1})
 	e.flush()
 
 	for i := range e.in {
 		e.in[i] = 0
 	}
-	for i := range e.out {
-		e.out[i] = 0
-	}
-	for i := range e.key {
-		e.key[i] = 0
-	}
 	for i := range e.nonce {
 		e.nonce[i] = 0
 	}
+	if e.ratchet != nil {
+		e.ratchet.zero()
+	}
+	if z, ok := e.aead.(keyZeroer); ok {
+		z.zero()
+	}
 	e.err = ErrAlreadyClosed
 	return err
 }
 
-func incrCounter(nonce *[24]byte) {
-	for i := 16; i < 24; i++ {
+func incrCounter(nonce []byte) {
+	for i := len(nonce) - 8; i < len(nonce); i++ {
 		nonce[i]++
 		if nonce[i] != 0 {
 			break
@@ -174,17 +289,24 @@ func incrCounter(nonce *[24]byte) {
 // Decryptor is an io.ReadCloser that reads encrypted data written by an
 // Encryptor.
 type Decryptor struct {
-	r     io.Reader
-	nonce *[24]byte
-	key   *[32]byte
-	rp    int // read position
-	eb    int // end of chunk, meaning depends on part of code
-	in    []byte
-	out   []byte
-	size  chunk // chunk size
-	err   error
-	next  chunk
-	last  bool
+	r               io.Reader
+	aead            cipher.AEAD
+	nonce           []byte
+	baseNonce       []byte // nonce as of chunk 0, used to seek to an arbitrary chunk
+	rp              int    // read position
+	eb              int    // end of chunk, meaning depends on part of code
+	out             []byte
+	size            chunk // chunk size
+	err             error
+	next            chunk
+	last            bool
+	headerLen       int64 // bytes preceding the first chunk's length prefix
+	chunkStart      int64 // plaintext offset of the start of the loaded chunk
+	curChunk        int64 // index of the chunk that will be loaded by the next fill
+	ratchet         *ratchetState
+	ratchetInterval uint32
+	context         []byte // bound to every chunk as AEAD associated data
+	contextTag      []byte // header tag read from the wire, checked against context in NewDecryptorWithContext
 }
 
 // NewDecryptor returns a new Decryptor. Nonce and key should be identical to
@@ -192,19 +314,68 @@ type Decryptor struct {
 //
 // Neither nonce or key are modified.
 func NewDecryptor(r io.Reader, nonce *[16]byte, key *[32]byte) (*Decryptor, error) {
-	d := Decryptor{r: r}
-	err := d.readHeaders()
+	var n [24]byte
+	copy(n[:], nonce[:])
+	var k [32]byte
+	copy(k[:], key[:])
+	return newDecryptor(r, secretboxAEAD{&k}, cipherSecretbox, n[:], 0)
+}
+
+// NewDecryptorAEAD returns a new Decryptor that opens chunks sealed by
+// NewEncryptorAEAD with the same aead. nonce must be aead.NonceSize() bytes
+// long and identical to the value originally passed to NewEncryptorAEAD.
+//
+// Neither nonce nor aead is modified.
+func NewDecryptorAEAD(r io.Reader, aead cipher.AEAD, nonce []byte) (*Decryptor, error) {
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrNonceSize
+	}
+	n := make([]byte, len(nonce))
+	copy(n, nonce)
+	return newDecryptor(r, aead, cipherAEAD, n, 0)
+}
+
+// NewDecryptorRatchet returns a new Decryptor that opens a stream sealed by
+// NewEncryptorRatchet or NewEncryptorRatchetSize, re-deriving each message
+// key from key exactly as the Encryptor did. Seek is not supported on the
+// returned Decryptor.
+//
+// Neither nonce nor key are modified.
+func NewDecryptorRatchet(r io.Reader, nonce *[16]byte, key *[32]byte) (*Decryptor, error) {
+	var n [24]byte
+	copy(n[:], nonce[:])
+
+	var msgKey [32]byte
+	d, err := newDecryptor(r, secretboxAEAD{&msgKey}, cipherSecretboxRatchet, n[:], 0)
 	if err != nil {
 		return nil, err
 	}
+	d.ratchet = newRatchetState(key, &msgKey, d.ratchetInterval)
+	return d, nil
+}
+
+// newDecryptor builds a Decryptor around aead/nonce. preLen is the number of
+// bytes already consumed from r before this call (e.g. by a password
+// header), used so Seek can compute absolute file offsets.
+func newDecryptor(r io.Reader, aead cipher.AEAD, cipherID byte, nonce []byte, preLen int64) (*Decryptor, error) {
+	d := Decryptor{r: r, aead: aead}
+	if err := d.readHeaders(cipherID, preLen); err != nil {
+		return nil, err
+	}
 	d.out = make([]byte, d.size)
-	d.in = make([]byte, offset+Overhead+d.size)
-	d.nonce, d.key = nonceKey(nonce, key)
+	d.nonce = nonce
+	d.baseNonce = append([]byte(nil), nonce...)
 	return &d, nil
 }
 
-func (d *Decryptor) readHeaders() error {
-	var buf [1 /* ver */ + 1 /* flags */ + 4 /* chunk */ + 4 /* next */ + 0]byte
+// readHeaders reads the fixed ver+cipherID+size header, the ratchet
+// interval if wantCipherID is cipherSecretboxRatchet, the context tag if
+// wantCipherID is cipherAEADContext, and finally the length prefix of chunk
+// 0. preLen is the number of bytes already consumed from d.r before this
+// call; d.headerLen ends up holding the file offset at which chunk 0's
+// length prefix begins, used by Seek.
+func (d *Decryptor) readHeaders(wantCipherID byte, preLen int64) error {
+	var buf [1 /* ver */ + 1 /* cipher id */ + 4] /* chunk */ byte
 	_, err := io.ReadFull(d.r, buf[:])
 	if err != nil {
 		return err
@@ -212,12 +383,41 @@ func (d *Decryptor) readHeaders() error {
 	if buf[0] != ver1 {
 		return errors.New("boxer: invalid version ID")
 	}
-	_ = buf[1] // Future: flags.
+	if buf[1] != wantCipherID {
+		return ErrCipherID
+	}
 	d.size = chunk(binary.LittleEndian.Uint32(buf[2:]))
 	if d.size >= math.MaxInt32 {
 		return ErrChunkSize
 	}
-	d.next = chunk(binary.LittleEndian.Uint32(buf[6:]))
+	hdrLen := int64(len(buf))
+
+	if wantCipherID == cipherSecretboxRatchet {
+		var ri [4]byte
+		if _, err := io.ReadFull(d.r, ri[:]); err != nil {
+			return err
+		}
+		d.ratchetInterval = binary.LittleEndian.Uint32(ri[:])
+		if d.ratchetInterval == 0 {
+			return ErrRatchetInterval
+		}
+		hdrLen += int64(len(ri))
+	}
+	if wantCipherID == cipherAEADContext {
+		tag := make([]byte, d.aead.Overhead())
+		if _, err := io.ReadFull(d.r, tag); err != nil {
+			return err
+		}
+		d.contextTag = tag
+		hdrLen += int64(len(tag))
+	}
+	d.headerLen = preLen + hdrLen
+
+	var next [4]byte
+	if _, err := io.ReadFull(d.r, next[:]); err != nil {
+		return err
+	}
+	d.next = chunk(binary.LittleEndian.Uint32(next[:]))
 	return nil
 }
 
@@ -246,13 +446,16 @@ func (d *Decryptor) fill() (err error) {
 		return d.err
 	}
 
-	d.eb, err = d.r.Read(d.in[:d.next+offset])
+	buf := getBuf(offset + d.aead.Overhead() + int(d.size))
+	defer putBuf(buf)
+
+	d.eb, err = d.r.Read(buf[:d.next+offset])
 	if err != nil {
 		return err
 	}
 
 	d.rp = 0
-	d.next = chunk(binary.LittleEndian.Uint32(d.in[d.eb-offset:]))
+	d.next = chunk(binary.LittleEndian.Uint32(buf[d.eb-offset:]))
 
 	// The minimum read should be 18 bytes. The only time we'll
 	// have less is the very end where our buffer looks like:
@@ -261,21 +464,21 @@ func (d *Decryptor) fill() (err error) {
 	//   |_____________________________| |_ EOF byte
 	//                  |
 	//        16 bytes of authenticator
-	if d.eb < Overhead+offset {
+	if d.eb < d.aead.Overhead()+offset {
 		d.last = true
-		d.nonce[23] |= 0x80
+		d.nonce[len(d.nonce)-1] |= 0x80
 	} else {
 		d.eb -= offset
 	}
 
 	// If we're reading the last chunk it's okay to have an invalid next chunk.
 	// It might be left over data from the previous read.
-	if !d.last && (d.next <= 0 || d.next > d.size+Overhead) {
+	if !d.last && (d.next <= 0 || d.next > d.size+chunk(d.aead.Overhead())) {
 		return ErrInvalidData
 	}
 
-	m, ok := secretbox.Open(d.out[:0], d.in[:d.eb], d.nonce, d.key)
-	if !ok {
+	m, err := d.aead.Open(d.out[:0], d.nonce, buf[:d.eb], d.context)
+	if err != nil {
 		return ErrInvalidData
 	}
 	d.eb = len(m)
@@ -285,7 +488,12 @@ func (d *Decryptor) fill() (err error) {
 		}
 		return io.EOF
 	}
+	d.chunkStart = d.curChunk * int64(d.size)
+	d.curChunk++
 	incrCounter(d.nonce)
+	if d.ratchet != nil {
+		d.ratchet.step()
+	}
 	return nil
 }
 
@@ -294,18 +502,18 @@ func (d *Decryptor) Close() error {
 	if d.err == ErrAlreadyClosed {
 		return ErrAlreadyClosed
 	}
-	for i := range d.in {
-		d.in[i] = 0
-	}
 	for i := range d.out {
 		d.out[i] = 0
 	}
-	for i := range d.key {
-		d.key[i] = 0
-	}
 	for i := range d.nonce {
 		d.nonce[i] = 0
 	}
+	if d.ratchet != nil {
+		d.ratchet.zero()
+	}
+	if z, ok := d.aead.(keyZeroer); ok {
+		z.zero()
+	}
 	d.err = ErrAlreadyClosed
 	return nil
 }
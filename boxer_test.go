@@ -63,3 +63,35 @@ func TestInvalidSize(t *testing.T) {
 		t.Fatal("wanted err != nil, got err == nil")
 	}
 }
+
+func TestWrongKey(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncryptor(&buf, nonce, key)
+	e.Write(data)
+	e.Close()
+
+	wrongKey := &[32]byte{1}
+	d, err := NewDecryptor(&buf, nonce, wrongKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, d); err != ErrInvalidData {
+		t.Fatalf("wanted ErrInvalidData, got %v", err)
+	}
+}
+
+func TestWrongNonce(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncryptor(&buf, nonce, key)
+	e.Write(data)
+	e.Close()
+
+	wrongNonce := &[16]byte{1}
+	d, err := NewDecryptor(&buf, wrongNonce, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, d); err != ErrInvalidData {
+		t.Fatalf("wanted ErrInvalidData, got %v", err)
+	}
+}
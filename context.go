@@ -0,0 +1,69 @@
+package boxer
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// NewEncryptorContext returns a new Encryptor, using the default chunk size,
+// that binds every chunk to context as AEAD associated data. A tag of
+// context, sealed under aead (not a plain hash: see headerNonce), is written
+// to the header so NewDecryptorWithContext can detect a wrong context, or
+// tampering with the header itself, immediately on construction rather than
+// waiting for the first chunk to fail to decrypt.
+//
+// Binding is only as strong as aead's support for associated data;
+// secretboxAEAD ignores it, so aead must be a real cipher.AEAD (e.g. one
+// passed to NewEncryptorAEAD).
+//
+// Neither nonce, context, nor aead is modified; the Encryptor increments
+// its own copy of nonce as chunks are written.
+func NewEncryptorContext(w io.Writer, aead cipher.AEAD, nonce, context []byte) (*Encryptor, error) {
+	return NewEncryptorContextSize(w, aead, nonce, context, DefaultChunkSize)
+}
+
+// NewEncryptorContextSize is like NewEncryptorContext but allows specifying
+// the maximum chunk size.
+func NewEncryptorContextSize(w io.Writer, aead cipher.AEAD, nonce, context []byte, size int) (*Encryptor, error) {
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrNonceSize
+	}
+	n := make([]byte, len(nonce))
+	copy(n, nonce)
+	c := append([]byte(nil), context...)
+	return newEncryptor(w, aead, cipherAEADContext, n, size, 0, c)
+}
+
+// NewDecryptorWithContext returns a new Decryptor that opens a stream sealed
+// by NewEncryptorContext or NewEncryptorContextSize, binding context as AEAD
+// associated data exactly as the Encryptor did. It returns ErrInvalidData if
+// context doesn't match the tag stored in the header, which catches both a
+// wrong context and a tampered header under aead's key.
+//
+// Neither nonce, context, nor aead is modified.
+func NewDecryptorWithContext(r io.Reader, aead cipher.AEAD, nonce, context []byte) (*Decryptor, error) {
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrNonceSize
+	}
+	n := make([]byte, len(nonce))
+	copy(n, nonce)
+	d, err := newDecryptor(r, aead, cipherAEADContext, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := aead.Open(nil, headerNonce(n), d.contextTag, context); err != nil {
+		return nil, ErrInvalidData
+	}
+	d.context = append([]byte(nil), context...)
+	return d, nil
+}
+
+// headerNonce derives the nonce used to seal/verify a stream's context tag
+// from its chunk nonce, with the top bit of the first byte flipped so it
+// never collides with a nonce used to seal an actual chunk (chunk nonces are
+// only ever incremented in their low 8 bytes; see incrCounter).
+func headerNonce(nonce []byte) []byte {
+	h := append([]byte(nil), nonce...)
+	h[0] ^= 0x80
+	return h
+}
@@ -0,0 +1,89 @@
+package boxer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestValidCryptContext(t *testing.T) {
+	aeadKey := [32]byte{1, 2, 3}
+	aead, err := chacha20poly1305.New(aeadKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := make([]byte, aead.NonceSize())
+	ctx := []byte("tenant:acme/stream:7")
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorContext(&buf, aead, n, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	d, err := NewDecryptorWithContext(&buf, aead, n, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out) {
+		t.Fatalf("data len == %d, out len == %d", len(data), len(out))
+	}
+}
+
+func TestWrongContext(t *testing.T) {
+	aeadKey := [32]byte{1, 2, 3}
+	aead, err := chacha20poly1305.New(aeadKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := make([]byte, aead.NonceSize())
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorContext(&buf, aead, n, []byte("stream:7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	// A wrong context is rejected at construction time, via the header tag,
+	// before any chunk is read.
+	if _, err := NewDecryptorWithContext(&buf, aead, n, []byte("stream:8")); err != ErrInvalidData {
+		t.Fatalf("wanted ErrInvalidData, got %v", err)
+	}
+}
+
+func TestTamperedContextHeader(t *testing.T) {
+	aeadKey := [32]byte{1, 2, 3}
+	aead, err := chacha20poly1305.New(aeadKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := make([]byte, aead.NonceSize())
+	ctx := []byte("stream:7")
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorContext(&buf, aead, n, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	// Flip the first byte of the header-written tag itself (not just the context
+	// supplied locally): since the tag is sealed under aead's key, this
+	// must be rejected even though the caller's context is correct.
+	raw := buf.Bytes()
+	raw[6] ^= 0xff
+	if _, err := NewDecryptorWithContext(bytes.NewReader(raw), aead, n, ctx); err != ErrInvalidData {
+		t.Fatalf("wanted ErrInvalidData, got %v", err)
+	}
+}
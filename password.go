@@ -0,0 +1,168 @@
+package boxer
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic identifies a stream produced by NewEncryptorPassword so
+// NewDecryptorPassword can tell a password-protected file apart from a raw
+// key/nonce one.
+var magic = [8]byte{'B', 'O', 'X', 'E', 'R', 0, 0, 0}
+
+// ErrBadMagic is returned by NewDecryptorPassword when r does not begin
+// with the boxer magic header.
+var ErrBadMagic = errors.New("boxer: invalid magic header")
+
+const (
+	saltSize    = 16
+	pwNonceSize = 24
+	keySize     = 32
+
+	// passwordHeaderBytes is the size, in bytes, of the header written by
+	// writePasswordHeader: magic + N/r/p + salt + nonce.
+	passwordHeaderBytes = 8 + 4 + 4 + 4 + saltSize + pwNonceSize
+)
+
+// PasswordOpts configures the scrypt parameters used to derive a key from a
+// passphrase. A nil *PasswordOpts passed to NewEncryptorPassword or
+// NewEncryptorPasswordSize uses DefaultPasswordOpts.
+type PasswordOpts struct {
+	N, R, P int
+}
+
+// DefaultPasswordOpts are the scrypt parameters used when a nil
+// *PasswordOpts is supplied. They match scrypt's recommended interactive
+// parameters.
+var DefaultPasswordOpts = &PasswordOpts{N: 1 << 15, R: 8, P: 1}
+
+func (o *PasswordOpts) orDefault() *PasswordOpts {
+	if o == nil {
+		return DefaultPasswordOpts
+	}
+	return o
+}
+
+// NewEncryptorPassword returns a new Encryptor, using the default chunk
+// size, that derives its key from password with scrypt rather than
+// requiring the caller to manage a raw key and nonce. A random salt and
+// nonce are generated and, along with the scrypt parameters, written to a
+// self-describing header ahead of the usual boxer header, so the stream can
+// later be opened with nothing but the passphrase via NewDecryptorPassword.
+//
+// Password is not modified or retained.
+func NewEncryptorPassword(w io.Writer, password []byte, opts *PasswordOpts) (*Encryptor, error) {
+	return NewEncryptorPasswordSize(w, password, opts, DefaultChunkSize)
+}
+
+// NewEncryptorPasswordSize is like NewEncryptorPassword but allows
+// specifying the maximum chunk size.
+func NewEncryptorPasswordSize(w io.Writer, password []byte, opts *PasswordOpts, size int) (*Encryptor, error) {
+	opts = opts.orDefault()
+
+	var salt [saltSize]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	var nonce [pwNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(password, salt[:], opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writePasswordHeader(w, opts, salt[:], nonce[:]); err != nil {
+		return nil, err
+	}
+
+	var k [32]byte
+	copy(k[:], key)
+	return newEncryptor(w, secretboxAEAD{&k}, cipherSecretbox, nonce[:], size, 0, nil)
+}
+
+// NewDecryptorPassword returns a new Decryptor that reads a stream produced
+// by NewEncryptorPassword, re-deriving the key from password using the
+// scrypt parameters and salt stored in the header.
+//
+// Password is not modified or retained.
+func NewDecryptorPassword(r io.Reader, password []byte) (*Decryptor, error) {
+	opts, salt, nonce, err := readPasswordHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(password, salt, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var k [32]byte
+	copy(k[:], key)
+	return newDecryptor(r, secretboxAEAD{&k}, cipherSecretbox, nonce, passwordHeaderBytes)
+}
+
+func deriveKey(password, salt []byte, opts *PasswordOpts) ([]byte, error) {
+	return scrypt.Key(password, salt, opts.N, opts.R, opts.P, keySize)
+}
+
+// writePasswordHeader writes magic + N/r/p + salt + nonce: everything
+// NewDecryptorPassword needs to re-derive the key before it hands off to
+// newDecryptor. It carries no version or cipher ID of its own; those are the
+// boxer header's job, written immediately after by newEncryptor, so the
+// scrypt framing isn't independently versioned.
+func writePasswordHeader(w io.Writer, opts *PasswordOpts, salt, nonce []byte) error {
+	if _, err := w.Write(magic[:]); err != nil {
+		return err
+	}
+	var params [4 + 4 + 4]byte
+	binary.LittleEndian.PutUint32(params[0:], uint32(opts.N))
+	binary.LittleEndian.PutUint32(params[4:], uint32(opts.R))
+	binary.LittleEndian.PutUint32(params[8:], uint32(opts.P))
+	if _, err := w.Write(params[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return err
+	}
+	_, err := w.Write(nonce)
+	return err
+}
+
+func readPasswordHeader(r io.Reader) (opts *PasswordOpts, salt, nonce []byte, err error) {
+	var m [8]byte
+	if _, err = io.ReadFull(r, m[:]); err != nil {
+		return nil, nil, nil, err
+	}
+	if m != magic {
+		return nil, nil, nil, ErrBadMagic
+	}
+
+	var params [4 + 4 + 4]byte
+	if _, err = io.ReadFull(r, params[:]); err != nil {
+		return nil, nil, nil, err
+	}
+	opts = &PasswordOpts{
+		N: int(binary.LittleEndian.Uint32(params[0:])),
+		R: int(binary.LittleEndian.Uint32(params[4:])),
+		P: int(binary.LittleEndian.Uint32(params[8:])),
+	}
+
+	salt = make([]byte, saltSize)
+	if _, err = io.ReadFull(r, salt); err != nil {
+		return nil, nil, nil, err
+	}
+
+	nonce = make([]byte, pwNonceSize)
+	if _, err = io.ReadFull(r, nonce); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return opts, salt, nonce, nil
+}
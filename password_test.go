@@ -0,0 +1,51 @@
+package boxer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fastPasswordOpts keeps scrypt's cost low enough for tests to run quickly.
+var fastPasswordOpts = &PasswordOpts{N: 1 << 10, R: 8, P: 1}
+
+func TestValidCryptPassword(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := NewEncryptorPassword(&buf, []byte("hunter2"), fastPasswordOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	d, err := NewDecryptorPassword(&buf, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, d); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Fatalf("data len == %d, out len == %d", len(data), out.Len())
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := NewEncryptorPassword(&buf, []byte("hunter2"), fastPasswordOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(data)
+	e.Close()
+
+	d, err := NewDecryptorPassword(&buf, []byte("wrong password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, d); err != ErrInvalidData {
+		t.Fatalf("wanted ErrInvalidData, got %v", err)
+	}
+}
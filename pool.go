@@ -0,0 +1,172 @@
+package boxer
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// scratchPool holds the transient ciphertext buffers used by flush, fill,
+// ReadFrom, and WriteTo. Pooling them keeps a stream's steady-state
+// allocation down to the one chunk-sized buffer each side must hold
+// persistently (Encryptor.in to accumulate a partial chunk across Writes,
+// Decryptor.out to let a chunk be drained across several Reads), instead of
+// an additional chunk-sized buffer per stream.
+var scratchPool = sync.Pool{
+	New: func() interface{} { return make([]byte, 0) },
+}
+
+// getBuf returns a []byte of length n from scratchPool, allocating a new
+// one if the pooled buffer is too small.
+func getBuf(n int) []byte {
+	buf := scratchPool.Get().([]byte)
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+func putBuf(buf []byte) {
+	scratchPool.Put(buf[:0])
+}
+
+// ReadFrom implements io.ReaderFrom. It reads chunks from r directly into a
+// pooled scratch buffer and seals them in place, avoiding the copy into
+// e.in that Write performs when fed less than a full chunk at a time.
+func (e *Encryptor) ReadFrom(r io.Reader) (n int64, err error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	// Top off and flush any chunk partially filled by a previous Write so
+	// the loop below can start clean with e.n == 0.
+	if e.n > 0 {
+		m, rerr := io.ReadFull(r, e.in[e.n:e.size])
+		e.n += m
+		n += int64(m)
+		switch {
+		case e.n == e.size:
+			if ferr := e.flush(); ferr != nil {
+				e.err = ferr
+				return n, ferr
+			}
+		case rerr == io.EOF || rerr == io.ErrUnexpectedEOF:
+			return n, nil
+		case rerr != nil:
+			e.err = rerr
+			return n, rerr
+		}
+	}
+
+	buf := getBuf(offset + e.aead.Overhead() + e.size)
+	defer putBuf(buf)
+
+	for {
+		nr, rerr := io.ReadFull(r, buf[offset:offset+e.size])
+		if nr > 0 {
+			enc := e.aead.Seal(buf[offset:offset], e.nonce, buf[offset:offset+nr], e.context)
+			binary.LittleEndian.PutUint32(buf[0:], uint32(len(enc)))
+			if _, werr := e.w.Write(buf[:offset+len(enc)]); werr != nil {
+				e.err = werr
+				return n, werr
+			}
+			n += int64(nr)
+			incrCounter(e.nonce)
+			if e.ratchet != nil {
+				e.ratchet.step()
+			}
+		}
+		switch rerr {
+		case nil:
+			continue
+		case io.EOF, io.ErrUnexpectedEOF:
+			return n, nil
+		default:
+			e.err = rerr
+			return n, rerr
+		}
+	}
+}
+
+// WriteTo implements io.WriterTo. It opens chunks directly from a pooled
+// scratch buffer and writes each one to w with a single Write call.
+func (d *Decryptor) WriteTo(w io.Writer) (n int64, err error) {
+	if d.err != nil && d.err != io.EOF {
+		return 0, d.err
+	}
+
+	// Drain whatever's left in d.out from a previous Read first.
+	if d.rp < d.eb {
+		m, werr := w.Write(d.out[d.rp:d.eb])
+		n += int64(m)
+		d.rp = d.eb
+		if werr != nil {
+			d.err = werr
+			return n, werr
+		}
+	}
+	if d.err == io.EOF {
+		return n, nil
+	}
+
+	buf := getBuf(offset + d.aead.Overhead() + int(d.size))
+	defer putBuf(buf)
+
+	for {
+		eb, rerr := d.r.Read(buf[:d.next+offset])
+		if rerr != nil {
+			d.err = rerr
+			break
+		}
+
+		next := chunk(binary.LittleEndian.Uint32(buf[eb-offset:]))
+
+		var last bool
+		if eb < d.aead.Overhead()+offset {
+			last = true
+			d.nonce[len(d.nonce)-1] |= 0x80
+		} else {
+			eb -= offset
+		}
+
+		if !last && (next <= 0 || next > d.size+chunk(d.aead.Overhead())) {
+			d.err = ErrInvalidData
+			break
+		}
+
+		m, operr := d.aead.Open(buf[:0], d.nonce, buf[:eb], d.context)
+		if operr != nil {
+			d.err = ErrInvalidData
+			break
+		}
+
+		if last {
+			if len(m) != 1 || m[0] != 1 {
+				d.err = ErrInvalidData
+			} else {
+				d.err = io.EOF
+			}
+			break
+		}
+
+		wn, werr := w.Write(m)
+		n += int64(wn)
+		if werr != nil {
+			d.err = werr
+			break
+		}
+
+		d.chunkStart = d.curChunk * int64(d.size)
+		d.curChunk++
+		incrCounter(d.nonce)
+		if d.ratchet != nil {
+			d.ratchet.step()
+		}
+		d.next = next
+	}
+
+	if d.err == io.EOF {
+		return n, nil
+	}
+	return n, d.err
+}
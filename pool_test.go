@@ -0,0 +1,92 @@
+package boxer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// readerOnly strips any WriterTo a Reader might implement (bytes.Reader has
+// one) so io.Copy is forced through dst's ReaderFrom instead of src's
+// WriterTo, exercising Encryptor.ReadFrom itself.
+type readerOnly struct{ io.Reader }
+
+// decryptAll decrypts the ciphertext in buf with nonce/key and returns the
+// recovered plaintext.
+func decryptAll(t *testing.T, buf []byte) []byte {
+	t.Helper()
+	d, err := NewDecryptor(bytes.NewReader(buf), nonce, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestReadFromLengths(t *testing.T) {
+	const size = 16
+	for _, n := range []int{0, size - 1, size, size + 1, 3*size + 5} {
+		plain := make([]byte, n)
+		for i := range plain {
+			plain[i] = byte(i)
+		}
+
+		var buf bytes.Buffer
+		e, err := NewEncryptorSize(&buf, nonce, key, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(e, readerOnly{bytes.NewReader(plain)}); err != nil {
+			t.Fatalf("n=%d: ReadFrom: %v", n, err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := decryptAll(t, buf.Bytes())
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("n=%d: got %d bytes, want %d", n, len(got), len(plain))
+		}
+	}
+}
+
+// TestReadFromTopOff exercises the e.n > 0 top-off path in ReadFrom: a
+// partial Write leaves a chunk half full, ReadFrom must finish filling and
+// flushing it before it starts reading full chunks of its own, and a
+// trailing Write must still land in a fresh chunk afterwards.
+func TestReadFromTopOff(t *testing.T) {
+	const size = 16
+	plain := make([]byte, 5*size+3)
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorSize(&buf, nonce, key, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const partial = 6 // < size, leaves the chunk topped off by ReadFrom
+	if _, err := e.Write(plain[:partial]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(e, readerOnly{bytes.NewReader(plain[partial : len(plain)-2])}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Write(plain[len(plain)-2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := decryptAll(t, buf.Bytes())
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(plain))
+	}
+}
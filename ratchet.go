@@ -0,0 +1,98 @@
+package boxer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// ErrRatchetInterval is returned when a ratchet interval of 0 is supplied,
+// or read back from a stream's header.
+var ErrRatchetInterval = errors.New("boxer: ratchet interval must be > 0")
+
+// ratchetState derives a fresh message key from a chain key every interval
+// chunks, using a simplified symmetric ratchet in the style of Pond/Signal:
+// messageKey = HMAC-SHA256(chainKey, "msg"), chainKey' =
+// HMAC-SHA256(chainKey, "chain"). msgKey points at the key backing the
+// Encryptor's or Decryptor's secretboxAEAD, so rotating it takes effect on
+// the very next chunk without rebuilding the AEAD. Because the chain only
+// moves forward, compromising the key in use at any point does not expose
+// chunks sealed before the most recent rotation.
+type ratchetState struct {
+	chainKey [32]byte
+	msgKey   *[32]byte
+	interval uint32
+	count    uint32
+}
+
+// newRatchetState seeds the chain from key and derives the first message
+// key into msgKey.
+func newRatchetState(key, msgKey *[32]byte, interval uint32) *ratchetState {
+	r := &ratchetState{msgKey: msgKey, interval: interval}
+	copy(r.chainKey[:], key[:])
+	r.rotate()
+	return r
+}
+
+func (r *ratchetState) rotate() {
+	old := *r.msgKey
+
+	mac := hmac.New(sha256.New, r.chainKey[:])
+	mac.Write([]byte("msg"))
+	copy(r.msgKey[:], mac.Sum(nil))
+
+	mac = hmac.New(sha256.New, r.chainKey[:])
+	mac.Write([]byte("chain"))
+	copy(r.chainKey[:], mac.Sum(nil))
+
+	for i := range old {
+		old[i] = 0
+	}
+}
+
+// step is called after each chunk is sealed or opened; it rotates the
+// message key every interval chunks.
+func (r *ratchetState) step() {
+	r.count++
+	if r.count%r.interval == 0 {
+		r.rotate()
+	}
+}
+
+func (r *ratchetState) zero() {
+	for i := range r.chainKey {
+		r.chainKey[i] = 0
+	}
+	for i := range r.msgKey {
+		r.msgKey[i] = 0
+	}
+}
+
+// NewEncryptorRatchet returns a new Encryptor, using the default chunk
+// size, that re-keys every interval chunks via a forward-secure ratchet
+// seeded from key (see ratchetState). interval must be greater than 0.
+//
+// Neither nonce nor key are modified.
+func NewEncryptorRatchet(w io.Writer, nonce *[16]byte, key *[32]byte, interval uint32) (*Encryptor, error) {
+	return NewEncryptorRatchetSize(w, nonce, key, interval, DefaultChunkSize)
+}
+
+// NewEncryptorRatchetSize is like NewEncryptorRatchet but allows specifying
+// the maximum chunk size.
+func NewEncryptorRatchetSize(w io.Writer, nonce *[16]byte, key *[32]byte, interval uint32, size int) (*Encryptor, error) {
+	if interval == 0 {
+		return nil, ErrRatchetInterval
+	}
+
+	var n [24]byte
+	copy(n[:], nonce[:])
+
+	var msgKey [32]byte
+	e, err := newEncryptor(w, secretboxAEAD{&msgKey}, cipherSecretboxRatchet, n[:], size, interval, nil)
+	if err != nil {
+		return nil, err
+	}
+	e.ratchet = newRatchetState(key, &msgKey, interval)
+	return e, nil
+}
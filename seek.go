@@ -0,0 +1,100 @@
+package boxer
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrNotSeekable is returned by Seek when the Decryptor's underlying reader
+// does not implement io.ReadSeeker.
+var ErrNotSeekable = errors.New("boxer: underlying reader is not an io.ReadSeeker")
+
+// ErrWhence is returned by Seek for an unsupported whence value. Only
+// io.SeekStart and io.SeekCurrent are supported; the plaintext length of
+// the stream isn't known without decrypting it, so io.SeekEnd cannot be
+// honored.
+var ErrWhence = errors.New("boxer: unsupported whence")
+
+// ErrRatchetSeek is returned by Seek on a Decryptor constructed with
+// NewDecryptorRatchet: the ratchet chain only moves forward, so an
+// arbitrary chunk's message key cannot be recovered without replaying
+// every rotation from chunk 0.
+var ErrRatchetSeek = errors.New("boxer: Seek is not supported on ratcheted streams")
+
+// Seek implements io.Seeker, allowing random access to the plaintext of a
+// stream produced by an Encryptor, provided the Decryptor's underlying
+// reader is an io.ReadSeeker. Only io.SeekStart and io.SeekCurrent are
+// supported.
+//
+// Seeking relies on every chunk but the last being exactly size bytes of
+// plaintext, which always holds for chunks written by Encryptor.Write; a
+// plaintext offset p therefore maps deterministically to chunk index
+// p/size at file offset headerLen + index*(size+Overhead+offset), with an
+// intra-chunk offset of p%size.
+func (d *Decryptor) Seek(off int64, whence int) (int64, error) {
+	if d.ratchet != nil {
+		return 0, ErrRatchetSeek
+	}
+	rs, ok := d.r.(io.ReadSeeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = off
+	case io.SeekCurrent:
+		abs = d.chunkStart + int64(d.rp) + off
+	default:
+		return 0, ErrWhence
+	}
+	if abs < 0 {
+		return 0, errors.New("boxer: negative position")
+	}
+
+	size := int64(d.size)
+	idx := abs / size
+	intra := abs % size
+
+	chunkWire := int64(offset) + int64(d.aead.Overhead()) + size
+	fileOff := d.headerLen + idx*chunkWire
+
+	if _, err := rs.Seek(fileOff, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// The chunk at fileOff is prefixed with its own length, which fill
+	// expects to already be in d.next.
+	var lenBuf [offset]byte
+	if _, err := io.ReadFull(rs, lenBuf[:]); err != nil {
+		return 0, err
+	}
+	d.next = chunk(binary.LittleEndian.Uint32(lenBuf[:]))
+	d.last = false
+	d.err = nil
+	d.curChunk = idx
+	resetCounter(d.nonce, d.baseNonce, uint64(idx))
+
+	if err := d.fill(); err != nil && err != io.EOF {
+		return 0, err
+	} else if err == io.EOF {
+		d.err = io.EOF
+	}
+	d.rp = int(intra)
+
+	return abs, nil
+}
+
+// resetCounter sets nonce to base with its trailing 8-byte little-endian
+// counter advanced by c, equivalent to calling incrCounter(nonce) c times
+// starting from base.
+func resetCounter(nonce, base []byte, c uint64) {
+	copy(nonce, base)
+	for i := len(nonce) - 8; i < len(nonce) && c > 0; i++ {
+		sum := uint64(nonce[i]) + c
+		nonce[i] = byte(sum)
+		c = sum >> 8
+	}
+}
@@ -0,0 +1,82 @@
+package boxer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSeek(t *testing.T) {
+	// Built rather than reusing the package's data so the test controls
+	// exactly how many whole chunks precede the final, partial one,
+	// regardless of what's available to populate data with.
+	const size = 16
+	plain := make([]byte, 5*size+7)
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+
+	var buf bytes.Buffer
+	e, err := NewEncryptorSize(&buf, nonce, key, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Write(plain)
+	e.Close()
+
+	r := bytes.NewReader(buf.Bytes())
+	d, err := NewDecryptor(r, nonce, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seek to the start of an interior chunk and check the bytes that
+	// follow match the plaintext at that offset.
+	const off = 3 * size
+	if _, err := d.Seek(off, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain[off:]) {
+		t.Fatalf("seek to %d: got %d bytes, want %d", off, len(got), len(plain[off:]))
+	}
+
+	// Seek into the final, partial chunk: its plaintext is shorter than
+	// size, so this also exercises reading right up against EOF.
+	lastChunkStart := (int64(len(plain)) / size) * size
+	d2, err := NewDecryptor(bytes.NewReader(buf.Bytes()), nonce, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d2.Seek(lastChunkStart, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got2, err := ioutil.ReadAll(d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got2, plain[lastChunkStart:]) {
+		t.Fatalf("seek to last chunk at %d: got %d bytes, want %d",
+			lastChunkStart, len(got2), len(plain[lastChunkStart:]))
+	}
+}
+
+func TestSeekNotSeekable(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncryptor(&buf, nonce, key)
+	e.Write(data)
+	e.Close()
+
+	// bytes.Buffer has no Seek method, unlike bytes.Reader.
+	d, err := NewDecryptor(&buf, nonce, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Seek(0, io.SeekStart); err != ErrNotSeekable {
+		t.Fatalf("wanted ErrNotSeekable, got %v", err)
+	}
+}